@@ -0,0 +1,207 @@
+// Package auth provides pluggable request authentication for the proxy
+// cache server.
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicRealm is sent in the WWW-Authenticate challenge when Basic auth is
+// active, so browsers prompt for credentials on failure.
+const basicRealm = "proxy-cache"
+
+// Authenticator validates an incoming request before it reaches the proxy
+// handlers.
+type Authenticator interface {
+	// Authenticate reports whether r carries valid credentials. realm is
+	// non-empty when the caller should respond with a WWW-Authenticate
+	// challenge for that realm on failure.
+	Authenticate(r *http.Request) (ok bool, realm string)
+}
+
+// NewAuth builds an Authenticator from a scheme-prefixed spec:
+//
+//	static://<token>               a single shared API key
+//	file://<path>                  one valid API key per line
+//	basic://<user>:<pass>          a single inline HTTP Basic credential
+//	basic:///path/to/.htpasswd     HTTP Basic backed by an htpasswd file
+//	                               (plaintext or bcrypt entries); the
+//	                               leading "/" is what selects this form
+//	                               over an inline user:pass credential
+func NewAuth(spec string) (Authenticator, error) {
+	scheme, rest, ok := strings.Cut(spec, "://")
+	if !ok {
+		return nil, fmt.Errorf("auth: %q is missing a scheme (static://, file://, basic://)", spec)
+	}
+	switch scheme {
+	case "static":
+		if rest == "" {
+			return nil, fmt.Errorf("auth: static:// requires a token")
+		}
+		return &staticAuth{token: rest}, nil
+	case "file":
+		tokens, err := loadTokens(rest)
+		if err != nil {
+			return nil, err
+		}
+		return &tokenListAuth{tokens: tokens}, nil
+	case "basic":
+		return newBasicAuth(rest)
+	default:
+		return nil, fmt.Errorf("auth: unknown scheme %q", scheme)
+	}
+}
+
+// apiKeyFromRequest reads the API key from the X-API-Key header, falling
+// back to the api_key query parameter.
+func apiKeyFromRequest(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// constantTimeEqual compares two secrets without leaking their content
+// through timing; secrets of different lengths are rejected at once, so a
+// length difference is not hidden. Empty secrets never match.
+func constantTimeEqual(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// staticAuth checks a single shared API key.
+type staticAuth struct {
+	token string
+}
+
+func (a *staticAuth) Authenticate(r *http.Request) (bool, string) {
+	return constantTimeEqual(apiKeyFromRequest(r), a.token), ""
+}
+
+// tokenListAuth accepts any key from a fixed list loaded once from a file.
+type tokenListAuth struct {
+	tokens []string
+}
+
+func (a *tokenListAuth) Authenticate(r *http.Request) (bool, string) {
+	key := apiKeyFromRequest(r)
+	if key == "" {
+		return false, ""
+	}
+	for _, t := range a.tokens {
+		if constantTimeEqual(key, t) {
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+func loadTokens(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: reading token file: %w", err)
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("auth: reading token file: %w", err)
+	}
+	return tokens, nil
+}
+
+// basicAuth implements HTTP Basic auth, either against a single inline
+// user:pass pair or an htpasswd-style file of "user:hash" lines. Hash
+// entries using a bcrypt prefix are verified with bcrypt; anything else is
+// compared as plaintext.
+type basicAuth struct {
+	creds map[string]string
+}
+
+// newBasicAuth disambiguates the two basic:// forms by leading slash, as
+// the docstring on NewAuth already promises ("basic:///path/to/.htpasswd"):
+// an inline user:pass can legitimately contain "/" (base64 tokens,
+// generated passwords), so a substring check would misroute it into the
+// file-path branch.
+func newBasicAuth(rest string) (*basicAuth, error) {
+	if strings.HasPrefix(rest, "/") {
+		creds, err := loadHtpasswd(rest)
+		if err != nil {
+			return nil, err
+		}
+		return &basicAuth{creds: creds}, nil
+	}
+	user, pass, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, fmt.Errorf("auth: basic:// inline credential must be user:pass")
+	}
+	return &basicAuth{creds: map[string]string{user: pass}}, nil
+}
+
+func loadHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: reading htpasswd file: %w", err)
+	}
+	defer f.Close()
+
+	creds := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		creds[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("auth: reading htpasswd file: %w", err)
+	}
+	return creds, nil
+}
+
+func (a *basicAuth) Authenticate(r *http.Request) (bool, string) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false, basicRealm
+	}
+	hash, known := a.creds[user]
+	if !known {
+		return false, basicRealm
+	}
+	if isBcryptHash(hash) {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+			return false, basicRealm
+		}
+		return true, ""
+	}
+	if !constantTimeEqual(pass, hash) {
+		return false, basicRealm
+	}
+	return true, ""
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
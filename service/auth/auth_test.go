@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewAuthSchemes(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, ".htpasswd")
+	hash, err := bcrypt.GenerateFromPassword([]byte("swordfish"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword: %v", err)
+	}
+	if err := os.WriteFile(htpasswd, []byte("alice:"+string(hash)+"\n"), 0644); err != nil {
+		t.Fatalf("writing htpasswd fixture: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"static", "static://my-token", false},
+		{"static missing token", "static://", true},
+		{"basic inline", "basic://user:pass", false},
+		{"basic inline with slash in password", "basic://user:pa/ss", false},
+		{"basic htpasswd file", "basic://" + htpasswd, false},
+		{"basic inline missing colon", "basic://justuser", true},
+		{"unknown scheme", "ftp://nope", true},
+		{"missing scheme", "no-scheme-here", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAuth(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAuth(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewAuthBasicInlinePasswordWithSlash(t *testing.T) {
+	a, err := NewAuth("basic://user:pa/ss")
+	if err != nil {
+		t.Fatalf("NewAuth: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+	r.SetBasicAuth("user", "pa/ss")
+	if ok, _ := a.Authenticate(r); !ok {
+		t.Fatal("expected inline credential with a slash in the password to authenticate")
+	}
+}
+
+func TestBasicAuthPlaintextAndBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("swordfish"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword: %v", err)
+	}
+	a := &basicAuth{creds: map[string]string{
+		"alice": string(hash),
+		"bob":   "plaintext-pass",
+	}}
+
+	req := func(user, pass string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+		r.SetBasicAuth(user, pass)
+		return r
+	}
+
+	if ok, _ := a.Authenticate(req("alice", "swordfish")); !ok {
+		t.Error("expected correct bcrypt password to authenticate")
+	}
+	if ok, _ := a.Authenticate(req("alice", "wrong")); ok {
+		t.Error("expected incorrect bcrypt password to be rejected")
+	}
+	if ok, _ := a.Authenticate(req("bob", "plaintext-pass")); !ok {
+		t.Error("expected correct plaintext password to authenticate")
+	}
+	if ok, _ := a.Authenticate(req("bob", "wrong")); ok {
+		t.Error("expected incorrect plaintext password to be rejected")
+	}
+	if ok, realm := a.Authenticate(req("carol", "whatever")); ok || realm != basicRealm {
+		t.Error("expected unknown user to be rejected with the basic realm")
+	}
+	if ok, realm := a.Authenticate(httptest.NewRequest(http.MethodGet, "/proxy", nil)); ok || realm != basicRealm {
+		t.Error("expected a request with no credentials to be rejected with the basic realm")
+	}
+}
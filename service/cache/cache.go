@@ -4,78 +4,167 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
+// Entry is a single cached response.
 type Entry struct {
 	Body    []byte
 	Headers http.Header
 	Expiry  time.Time
-}
 
-type Cache struct {
-	mu      sync.RWMutex
-	entries map[string]*Entry
+	// StoredAt is when this entry was fetched from the origin, used to
+	// compute the Age response header.
+	StoredAt time.Time
+
+	// ETag and LastModified are validators copied from the origin
+	// response, used for conditional revalidation once the entry expires.
+	ETag         string
+	LastModified string
+
+	// VaryKey is the full cache key this entry was stored under (the URL
+	// plus its Vary-derived hash); kept here so callers can tell which
+	// representation they hold.
+	VaryKey string
+
+	// StaleWhileRevalidate is how long after Expiry a stale copy may
+	// still be served while a background refresh is in flight.
+	StaleWhileRevalidate time.Duration
+
+	// MustRevalidate forbids serving this entry once stale, even within
+	// the stale-while-revalidate window.
+	MustRevalidate bool
 }
 
-func New() *Cache {
-	return &Cache{entries: make(map[string]*Entry)}
+// Fresh reports whether the entry can be served without contacting the
+// origin.
+func (e *Entry) Fresh() bool {
+	return time.Now().Before(e.Expiry)
 }
 
-func (c *Cache) Get(url string) (*Entry, bool) {
-	c.mu.RLock()
-	entry, ok := c.entries[url]
-	c.mu.RUnlock()
-	if !ok {
-		return nil, false
-	}
-	if time.Now().After(entry.Expiry) {
-		c.mu.Lock()
-		delete(c.entries, url)
-		c.mu.Unlock()
-		return nil, false
+// StaleButRevalidatable reports whether the entry is expired but still
+// within its stale-while-revalidate window.
+func (e *Entry) StaleButRevalidatable() bool {
+	if e.MustRevalidate || e.StaleWhileRevalidate <= 0 || e.Fresh() {
+		return false
 	}
-	return entry, true
+	return time.Now().Before(e.Expiry.Add(e.StaleWhileRevalidate))
 }
 
-func (c *Cache) Set(url string, entry *Entry) {
-	c.mu.Lock()
-	c.entries[url] = entry
-	c.mu.Unlock()
+// HasValidator reports whether the entry carries a validator usable for a
+// conditional GET.
+func (e *Entry) HasValidator() bool {
+	return e.ETag != "" || e.LastModified != ""
 }
 
-func (c *Cache) Delete(url string) bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if _, ok := c.entries[url]; !ok {
-		return false
+// Age returns the value of the Age header for this entry, in seconds.
+func (e *Entry) Age() int {
+	age := time.Since(e.StoredAt).Seconds()
+	if age < 0 {
+		return 0
 	}
-	delete(c.entries, url)
-	return true
+	return int(age)
+}
+
+// Store is a pluggable cache backend. Implementations may keep entries in
+// memory, on disk, or in an external store such as Redis.
+type Store interface {
+	// Get returns the entry for key regardless of freshness; callers
+	// decide whether a stale or expired entry is still usable.
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	Delete(key string) bool
+	// Len reports the number of entries currently held.
+	Len() int
+	// Purge removes every entry.
+	Purge()
+}
+
+// Directives is the parsed set of Cache-Control directives this proxy
+// understands, from either an origin response or an incoming request.
+type Directives struct {
+	NoStore        bool
+	NoCache        bool
+	Private        bool
+	Public         bool
+	MustRevalidate bool
+	Immutable      bool
+	OnlyIfCached   bool
+
+	// MaxAge and SMaxAge are -1 when absent; StaleWhileRevalidate is 0
+	// when absent.
+	MaxAge               int
+	SMaxAge              int
+	StaleWhileRevalidate int
 }
 
-// ParseCacheControl returns (max-age seconds, shouldStore).
-func ParseCacheControl(header string) (int, bool) {
+// ParseCacheControl parses a Cache-Control header value into its
+// directives. An empty header yields no directives set, MaxAge and SMaxAge
+// of -1, and so no freshness lifetime.
+func ParseCacheControl(header string) Directives {
+	d := Directives{MaxAge: -1, SMaxAge: -1}
 	if header == "" {
-		return 0, false
+		return d
 	}
-	directives := strings.Split(header, ",")
-	for _, d := range directives {
-		d = strings.TrimSpace(strings.ToLower(d))
-		if d == "no-store" {
-			return 0, false
-		}
-	}
-	for _, d := range directives {
-		d = strings.TrimSpace(strings.ToLower(d))
-		if strings.HasPrefix(d, "max-age=") {
-			val := strings.TrimPrefix(d, "max-age=")
-			seconds, err := strconv.Atoi(val)
-			if err == nil && seconds > 0 {
-				return seconds, true
+	for _, part := range strings.Split(header, ",") {
+		name, val, hasVal := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		val = strings.Trim(strings.TrimSpace(val), `"`)
+		switch name {
+		case "no-store":
+			d.NoStore = true
+		case "no-cache":
+			d.NoCache = true
+		case "private":
+			d.Private = true
+		case "public":
+			d.Public = true
+		case "must-revalidate":
+			d.MustRevalidate = true
+		case "immutable":
+			d.Immutable = true
+		case "only-if-cached":
+			d.OnlyIfCached = true
+		case "max-age":
+			if hasVal {
+				if n, err := strconv.Atoi(val); err == nil {
+					d.MaxAge = n
+				}
+			}
+		case "s-maxage":
+			if hasVal {
+				if n, err := strconv.Atoi(val); err == nil {
+					d.SMaxAge = n
+				}
+			}
+		case "stale-while-revalidate":
+			if hasVal {
+				if n, err := strconv.Atoi(val); err == nil {
+					d.StaleWhileRevalidate = n
+				}
 			}
 		}
 	}
-	return 0, false
+	return d
+}
+
+// ShouldStore reports whether a response carrying these directives may be
+// cached at all.
+func (d Directives) ShouldStore() bool {
+	if d.NoStore || d.Private {
+		return false
+	}
+	return d.MaxAge > 0 || d.SMaxAge > 0
+}
+
+// TTL returns the effective freshness lifetime in seconds, preferring
+// s-maxage over max-age (RFC 7234 section 5.2.2.9).
+func (d Directives) TTL() int {
+	if d.SMaxAge >= 0 {
+		return d.SMaxAge
+	}
+	if d.MaxAge >= 0 {
+		return d.MaxAge
+	}
+	return 0
 }
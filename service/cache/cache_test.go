@@ -0,0 +1,65 @@
+package cache
+
+import "testing"
+
+func TestParseCacheControl(t *testing.T) {
+	d := ParseCacheControl(`max-age=60, s-maxage=120, stale-while-revalidate=30, must-revalidate, no-cache, private, immutable, only-if-cached`)
+	if d.MaxAge != 60 {
+		t.Errorf("MaxAge = %d, want 60", d.MaxAge)
+	}
+	if d.SMaxAge != 120 {
+		t.Errorf("SMaxAge = %d, want 120", d.SMaxAge)
+	}
+	if d.StaleWhileRevalidate != 30 {
+		t.Errorf("StaleWhileRevalidate = %d, want 30", d.StaleWhileRevalidate)
+	}
+	if !d.MustRevalidate || !d.NoCache || !d.Private || !d.Immutable || !d.OnlyIfCached {
+		t.Errorf("expected all boolean directives set, got %+v", d)
+	}
+}
+
+func TestParseCacheControlEmpty(t *testing.T) {
+	d := ParseCacheControl("")
+	if d.MaxAge != -1 || d.SMaxAge != -1 {
+		t.Errorf("expected MaxAge/SMaxAge to default to -1 when absent, got %d/%d", d.MaxAge, d.SMaxAge)
+	}
+	if d.TTL() != 0 {
+		t.Errorf("TTL() = %d, want 0 for an absent Cache-Control header", d.TTL())
+	}
+}
+
+func TestDirectivesTTLPrefersSMaxAge(t *testing.T) {
+	d := Directives{MaxAge: 60, SMaxAge: 120}
+	if got := d.TTL(); got != 120 {
+		t.Errorf("TTL() = %d, want 120 (s-maxage preferred over max-age)", got)
+	}
+}
+
+func TestDirectivesTTLFallsBackToMaxAge(t *testing.T) {
+	d := Directives{MaxAge: 60, SMaxAge: -1}
+	if got := d.TTL(); got != 60 {
+		t.Errorf("TTL() = %d, want 60", got)
+	}
+}
+
+func TestDirectivesShouldStore(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Directives
+		want bool
+	}{
+		{"no-store always refuses", Directives{NoStore: true, MaxAge: 60}, false},
+		{"private always refuses", Directives{Private: true, MaxAge: 60}, false},
+		{"positive max-age allows", Directives{MaxAge: 60, SMaxAge: -1}, true},
+		{"positive s-maxage allows", Directives{MaxAge: -1, SMaxAge: 60}, true},
+		{"no freshness directive refuses", Directives{MaxAge: -1, SMaxAge: -1}, false},
+		{"zero max-age refuses", Directives{MaxAge: 0, SMaxAge: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.ShouldStore(); got != tt.want {
+				t.Errorf("ShouldStore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/metrics"
+)
+
+// diskSidecar is the on-disk JSON representation of an Entry's metadata;
+// the body is stored alongside it as a separate file so large bodies
+// aren't re-marshaled on every read.
+type diskSidecar struct {
+	Headers              http.Header   `json:"headers"`
+	Expiry               time.Time     `json:"expiry"`
+	StoredAt             time.Time     `json:"stored_at"`
+	ETag                 string        `json:"etag"`
+	LastModified         string        `json:"last_modified"`
+	VaryKey              string        `json:"vary_key"`
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate"`
+	MustRevalidate       bool          `json:"must_revalidate"`
+}
+
+type diskNode struct {
+	key  string
+	size int64
+}
+
+// Disk is a Store backed by files under dir, sharded two levels deep by
+// the SHA-256 of the cache key. An in-memory LRU-ordered index tracks
+// entry sizes for O(1) eviction without holding bodies in memory.
+type Disk struct {
+	dir        string
+	maxEntries int
+	maxBytes   int64
+
+	mu       sync.Mutex
+	ll       *list.List
+	index    map[string]*list.Element
+	curBytes int64
+}
+
+// NewDisk opens (creating if necessary) a disk-backed store rooted at
+// dir, rebuilding its index by scanning existing entries and dropping any
+// that have fully expired (past both Expiry and StaleWhileRevalidate).
+func NewDisk(dir string, maxEntries int, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cache: creating disk store dir: %w", err)
+	}
+	d := &Disk{
+		dir:        dir,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		index:      make(map[string]*list.Element),
+	}
+	if err := d.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Disk) shardPaths(key string) (dir, bodyPath, metaPath string) {
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	dir = filepath.Join(d.dir, hash[:2], hash[2:4])
+	return dir, filepath.Join(dir, hash+".body"), filepath.Join(dir, hash+".json")
+}
+
+// rebuildIndex walks the store directory on startup, populating the
+// in-memory index and deleting any entry that can no longer be served.
+func (d *Disk) rebuildIndex() error {
+	return filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		meta, err := readSidecar(path)
+		if err != nil {
+			log.Printf("cache: disk store skipping unreadable entry %s: %v", path, err)
+			return nil
+		}
+		bodyPath := strings.TrimSuffix(path, ".json") + ".body"
+		info, err := os.Stat(bodyPath)
+		if err != nil {
+			os.Remove(path)
+			return nil
+		}
+		if time.Now().After(meta.Expiry.Add(meta.StaleWhileRevalidate)) {
+			os.Remove(path)
+			os.Remove(bodyPath)
+			return nil
+		}
+
+		key := keyFromSidecarPath(path)
+		el := d.ll.PushFront(&diskNode{key: key, size: info.Size()})
+		d.index[key] = el
+		d.curBytes += info.Size()
+		return nil
+	})
+}
+
+// keyFromSidecarPath recovers the lookup key used to re-derive this
+// entry's shard path. Since the on-disk layout is keyed by the hash, not
+// the original URL, the hash itself doubles as the index key.
+func keyFromSidecarPath(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".json")
+}
+
+func readSidecar(path string) (*diskSidecar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta diskSidecar
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (d *Disk) Get(key string) (*Entry, bool) {
+	hashKey := hashOf(key)
+
+	d.mu.Lock()
+	el, ok := d.index[hashKey]
+	if ok {
+		d.ll.MoveToFront(el)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	_, bodyPath, metaPath := d.shardPaths(key)
+	meta, err := readSidecar(metaPath)
+	if err != nil {
+		return nil, false
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, false
+	}
+	return &Entry{
+		Body:                 body,
+		Headers:              meta.Headers,
+		Expiry:               meta.Expiry,
+		StoredAt:             meta.StoredAt,
+		ETag:                 meta.ETag,
+		LastModified:         meta.LastModified,
+		VaryKey:              meta.VaryKey,
+		StaleWhileRevalidate: meta.StaleWhileRevalidate,
+		MustRevalidate:       meta.MustRevalidate,
+	}, true
+}
+
+func (d *Disk) Set(key string, entry *Entry) {
+	dir, bodyPath, metaPath := d.shardPaths(key)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("cache: disk store mkdir %s: %v", dir, err)
+		return
+	}
+	if err := os.WriteFile(bodyPath, entry.Body, 0644); err != nil {
+		log.Printf("cache: disk store writing body: %v", err)
+		return
+	}
+	meta := diskSidecar{
+		Headers:              entry.Headers,
+		Expiry:               entry.Expiry,
+		StoredAt:             entry.StoredAt,
+		ETag:                 entry.ETag,
+		LastModified:         entry.LastModified,
+		VaryKey:              entry.VaryKey,
+		StaleWhileRevalidate: entry.StaleWhileRevalidate,
+		MustRevalidate:       entry.MustRevalidate,
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		log.Printf("cache: disk store marshaling sidecar: %v", err)
+		return
+	}
+	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+		log.Printf("cache: disk store writing sidecar: %v", err)
+		return
+	}
+
+	hashKey := hashOf(key)
+	size := int64(len(entry.Body))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.index[hashKey]; ok {
+		d.curBytes -= el.Value.(*diskNode).size
+		el.Value.(*diskNode).size = size
+		d.ll.MoveToFront(el)
+	} else {
+		el := d.ll.PushFront(&diskNode{key: hashKey, size: size})
+		d.index[hashKey] = el
+	}
+	d.curBytes += size
+	d.evictLocked()
+	metrics.SetBytes(d.curBytes)
+}
+
+func (d *Disk) evictLocked() {
+	for (d.maxEntries > 0 && d.ll.Len() > d.maxEntries) || (d.maxBytes > 0 && d.curBytes > d.maxBytes) {
+		back := d.ll.Back()
+		if back == nil {
+			return
+		}
+		node := back.Value.(*diskNode)
+		d.removeFilesByHash(node.key)
+		d.curBytes -= node.size
+		delete(d.index, node.key)
+		d.ll.Remove(back)
+		metrics.IncEvictions()
+	}
+}
+
+func (d *Disk) removeFilesByHash(hash string) {
+	dir := filepath.Join(d.dir, hash[:2], hash[2:4])
+	os.Remove(filepath.Join(dir, hash+".body"))
+	os.Remove(filepath.Join(dir, hash+".json"))
+}
+
+func (d *Disk) Delete(key string) bool {
+	hashKey := hashOf(key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	el, ok := d.index[hashKey]
+	if !ok {
+		return false
+	}
+	d.removeFilesByHash(hashKey)
+	d.curBytes -= el.Value.(*diskNode).size
+	delete(d.index, hashKey)
+	d.ll.Remove(el)
+	metrics.SetBytes(d.curBytes)
+	return true
+}
+
+func (d *Disk) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ll.Len()
+}
+
+func (d *Disk) Purge() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, el := range d.index {
+		d.removeFilesByHash(el.Value.(*diskNode).key)
+	}
+	d.ll.Init()
+	d.index = make(map[string]*list.Element)
+	d.curBytes = 0
+	metrics.SetBytes(0)
+}
+
+func hashOf(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewDiskPrunesExpiredEntriesOnRebuild(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := NewDisk(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+	d.Set("expired", &Entry{
+		Body:   []byte("stale"),
+		Expiry: time.Now().Add(-time.Hour),
+	})
+	d.Set("fresh", &Entry{
+		Body:   []byte("ok"),
+		Expiry: time.Now().Add(time.Hour),
+	})
+	d.Set("stale-but-revalidatable", &Entry{
+		Body:                 []byte("ok"),
+		Expiry:               time.Now().Add(-time.Hour),
+		StaleWhileRevalidate: 2 * time.Hour,
+	})
+
+	// Reopen against the same directory to exercise rebuildIndex.
+	reopened, err := NewDisk(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("NewDisk (reopen): %v", err)
+	}
+
+	if _, ok := reopened.Get("expired"); ok {
+		t.Error("expected an entry past Expiry+StaleWhileRevalidate to be pruned on rebuild")
+	}
+	if _, ok := reopened.Get("fresh"); !ok {
+		t.Error("expected a fresh entry to survive rebuild")
+	}
+	if _, ok := reopened.Get("stale-but-revalidatable"); !ok {
+		t.Error("expected an entry still within its stale-while-revalidate window to survive rebuild")
+	}
+	if got := reopened.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2 after pruning", got)
+	}
+}
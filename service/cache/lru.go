@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/metrics"
+)
+
+type lruNode struct {
+	key   string
+	entry *Entry
+}
+
+// LRU is a bounded in-memory Store. Once MaxEntries or MaxBytes is
+// exceeded it evicts the least recently used entry in O(1) via
+// container/list.
+type LRU struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	curBytes   int64
+	ll         *list.List
+	index      map[string]*list.Element
+}
+
+// NewLRU creates a bounded LRU store. A maxEntries or maxBytes of 0 means
+// unbounded on that dimension.
+func NewLRU(maxEntries int, maxBytes int64) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		index:      make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruNode).entry, true
+}
+
+func (c *LRU) Set(key string, entry *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.index[key]; ok {
+		c.curBytes -= int64(len(el.Value.(*lruNode).entry.Body))
+		el.Value.(*lruNode).entry = entry
+		c.ll.MoveToFront(el)
+	} else {
+		el := c.ll.PushFront(&lruNode{key: key, entry: entry})
+		c.index[key] = el
+	}
+	c.curBytes += int64(len(entry.Body))
+
+	c.evictLocked()
+	metrics.SetBytes(c.curBytes)
+}
+
+func (c *LRU) evictLocked() {
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.curBytes > c.maxBytes) {
+		back := c.ll.Back()
+		if back == nil {
+			return
+		}
+		c.removeElementLocked(back)
+		metrics.IncEvictions()
+	}
+}
+
+func (c *LRU) removeElementLocked(el *list.Element) {
+	node := el.Value.(*lruNode)
+	c.curBytes -= int64(len(node.entry.Body))
+	delete(c.index, node.key)
+	c.ll.Remove(el)
+}
+
+func (c *LRU) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.index[key]
+	if !ok {
+		return false
+	}
+	c.removeElementLocked(el)
+	metrics.SetBytes(c.curBytes)
+	return true
+}
+
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRU) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.index = make(map[string]*list.Element)
+	c.curBytes = 0
+	metrics.SetBytes(0)
+}
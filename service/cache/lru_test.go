@@ -0,0 +1,49 @@
+package cache
+
+import "testing"
+
+func TestLRUEvictsByMaxEntries(t *testing.T) {
+	c := NewLRU(2, 0)
+	c.Set("a", &Entry{Body: []byte("a")})
+	c.Set("b", &Entry{Body: []byte("b")})
+	c.Set("c", &Entry{Body: []byte("c")})
+
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", c.Len())
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected least-recently-used entry \"a\" to have been evicted")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("expected most recently set entry \"c\" to still be present")
+	}
+}
+
+func TestLRUEvictsByMaxBytes(t *testing.T) {
+	c := NewLRU(0, 10)
+	c.Set("a", &Entry{Body: make([]byte, 6)})
+	c.Set("b", &Entry{Body: make([]byte, 6)})
+
+	if c.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1 once MaxBytes is exceeded", c.Len())
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected \"a\" to have been evicted to stay under MaxBytes")
+	}
+}
+
+func TestLRUGetPromotesToFront(t *testing.T) {
+	c := NewLRU(2, 0)
+	c.Set("a", &Entry{Body: []byte("a")})
+	c.Set("b", &Entry{Body: []byte("b")})
+
+	c.Get("a") // touch "a" so "b" becomes the least recently used entry
+	c.Set("c", &Entry{Body: []byte("c")})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected \"b\" to have been evicted after \"a\" was touched")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected \"a\" to survive since it was the most recently used")
+	}
+}
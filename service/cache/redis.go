@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisMeta is the JSON payload stored as a plain string value under each
+// entry's metadata key (not as a Redis hash); the body lives in a separate
+// string key so metadata lookups don't have to pull large bodies over the
+// wire.
+type redisMeta struct {
+	Headers              http.Header   `json:"headers"`
+	Expiry               time.Time     `json:"expiry"`
+	StoredAt             time.Time     `json:"stored_at"`
+	ETag                 string        `json:"etag"`
+	LastModified         string        `json:"last_modified"`
+	VaryKey              string        `json:"vary_key"`
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate"`
+	MustRevalidate       bool          `json:"must_revalidate"`
+}
+
+// Redis is a Store backed by a Redis server. Eviction and the entry count
+// and byte-size bounds are left to Redis itself via maxmemory-policy; this
+// store just sets EXPIRE to match each entry's computed TTL.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis opens a Redis-backed store against the server at addr, with
+// all keys namespaced under prefix.
+func NewRedis(addr, prefix string) *Redis {
+	return &Redis{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		prefix: prefix,
+	}
+}
+
+func (r *Redis) metaKey(key string) string { return r.prefix + "meta:" + key }
+func (r *Redis) bodyKey(key string) string { return r.prefix + "body:" + key }
+
+func (r *Redis) Get(key string) (*Entry, bool) {
+	ctx := context.Background()
+
+	data, err := r.client.Get(ctx, r.metaKey(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var meta redisMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, false
+	}
+
+	body, err := r.client.Get(ctx, r.bodyKey(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	return &Entry{
+		Body:                 body,
+		Headers:              meta.Headers,
+		Expiry:               meta.Expiry,
+		StoredAt:             meta.StoredAt,
+		ETag:                 meta.ETag,
+		LastModified:         meta.LastModified,
+		VaryKey:              meta.VaryKey,
+		StaleWhileRevalidate: meta.StaleWhileRevalidate,
+		MustRevalidate:       meta.MustRevalidate,
+	}, true
+}
+
+func (r *Redis) Set(key string, entry *Entry) {
+	meta := redisMeta{
+		Headers:              entry.Headers,
+		Expiry:               entry.Expiry,
+		StoredAt:             entry.StoredAt,
+		ETag:                 entry.ETag,
+		LastModified:         entry.LastModified,
+		VaryKey:              entry.VaryKey,
+		StaleWhileRevalidate: entry.StaleWhileRevalidate,
+		MustRevalidate:       entry.MustRevalidate,
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	ttl := time.Until(entry.Expiry.Add(entry.StaleWhileRevalidate))
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	ctx := context.Background()
+	r.client.Set(ctx, r.metaKey(key), data, ttl)
+	r.client.Set(ctx, r.bodyKey(key), entry.Body, ttl)
+}
+
+func (r *Redis) Delete(key string) bool {
+	ctx := context.Background()
+	n, err := r.client.Del(ctx, r.metaKey(key), r.bodyKey(key)).Result()
+	return err == nil && n > 0
+}
+
+func (r *Redis) Len() int {
+	ctx := context.Background()
+	var count int
+	iter := r.client.Scan(ctx, 0, r.prefix+"meta:*", 0).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	return count
+}
+
+func (r *Redis) Purge() {
+	ctx := context.Background()
+	var keys []string
+	iter := r.client.Scan(ctx, 0, r.prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if len(keys) > 0 {
+		r.client.Del(ctx, keys...)
+	}
+}
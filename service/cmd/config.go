@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/cache"
+	"gopkg.in/yaml.v3"
+)
+
+// BackendsConfig selects and configures the cache storage backend.
+type BackendsConfig struct {
+	// Type is one of "memory" (default), "disk", or "redis".
+	Type string `yaml:"Type"`
+
+	// MaxBytes bounds the backend's total cached body size; 0 means
+	// unbounded. Applies to the memory and disk backends.
+	MaxBytes int64 `yaml:"MaxBytes"`
+
+	// Dir is the root directory for the disk backend.
+	Dir string `yaml:"Dir"`
+
+	// RedisAddr and RedisPrefix configure the redis backend.
+	RedisAddr   string `yaml:"RedisAddr"`
+	RedisPrefix string `yaml:"RedisPrefix"`
+}
+
+// Config mirrors the on-disk YAML configuration for the serve command,
+// modeled after Arvados keepproxy's Config.
+type Config struct {
+	Listen        string        `yaml:"Listen"`
+	Timeout       time.Duration `yaml:"Timeout"`
+	PIDFile       string        `yaml:"PIDFile"`
+	Debug         bool          `yaml:"Debug"`
+	DisableDelete bool          `yaml:"DisableDelete"`
+
+	// DefaultTTL is the max-age applied when an origin response has no
+	// Cache-Control directive of its own.
+	DefaultTTL time.Duration `yaml:"DefaultTTL"`
+
+	MaxEntries   int   `yaml:"MaxEntries"`
+	MaxBodyBytes int64 `yaml:"MaxBodyBytes"`
+
+	Auth     string         `yaml:"Auth"`
+	Backends BackendsConfig `yaml:"Backends"`
+
+	// Mode is "proxy" (default, the /proxy?url= endpoint) or "forward"
+	// (a transparent HTTP forward proxy with CONNECT support).
+	Mode string `yaml:"Mode"`
+
+	// UpstreamProxy chains outgoing requests through another proxy;
+	// falls back to HTTPS_PROXY/HTTP_PROXY when empty. Only used in
+	// forward mode.
+	UpstreamProxy string `yaml:"UpstreamProxy"`
+}
+
+// defaultConfig returns the configuration used when no --config file is
+// given, matching the previous flag-only defaults.
+func defaultConfig() Config {
+	return Config{
+		Listen:   ":8080",
+		Timeout:  30 * time.Second,
+		Auth:     "static://default-api-key",
+		Backends: BackendsConfig{Type: "memory"},
+		Mode:     "proxy",
+	}
+}
+
+// loadConfig reads and parses a YAML config file. An empty path returns
+// defaultConfig unchanged.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// newStore builds the cache.Store selected by cfg.Backends.
+func newStore(cfg Config) (cache.Store, error) {
+	switch cfg.Backends.Type {
+	case "", "memory":
+		return cache.NewLRU(cfg.MaxEntries, cfg.Backends.MaxBytes), nil
+	case "disk":
+		if cfg.Backends.Dir == "" {
+			return nil, fmt.Errorf("backends: disk store requires Dir")
+		}
+		return cache.NewDisk(cfg.Backends.Dir, cfg.MaxEntries, cfg.Backends.MaxBytes)
+	case "redis":
+		if cfg.Backends.RedisAddr == "" {
+			return nil, fmt.Errorf("backends: redis store requires RedisAddr")
+		}
+		prefix := cfg.Backends.RedisPrefix
+		if prefix == "" {
+			prefix = "proxy-cache:"
+		}
+		return cache.NewRedis(cfg.Backends.RedisAddr, prefix), nil
+	default:
+		return nil, fmt.Errorf("backends: unknown type %q", cfg.Backends.Type)
+	}
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/auth"
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/cache"
+)
+
+// resolveUpstreamProxy returns the upstream proxy to chain through,
+// preferring flagVal (--upstream-proxy) over the HTTPS_PROXY/HTTP_PROXY
+// environment variables. An empty result means dial origins directly.
+func resolveUpstreamProxy(flagVal string) string {
+	if flagVal != "" {
+		return flagVal
+	}
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// forwardHandler implements a standard HTTP forward proxy: absolute-URI
+// GET/HEAD requests are served by the same serveCached logic /proxy uses,
+// and CONNECT requests are tunneled to the origin by splicing bytes on
+// the hijacked connection. CONNECT traffic is opaque to this proxy and so
+// is never cached.
+type forwardHandler struct {
+	store         cache.Store
+	auth          auth.Authenticator
+	cfg           Config
+	upstreamProxy string
+}
+
+func (h *forwardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ok, realm := h.authenticateProxy(r)
+	if !ok {
+		if realm != "" {
+			w.Header().Set("Proxy-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+		}
+		http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		h.handleConnect(w, r)
+		return
+	}
+	h.handleForward(w, r)
+}
+
+// authenticateProxy checks proxy credentials per RFC 7235 section 3.2/4.3:
+// forward-proxy clients (browsers, curl --proxy-user, corporate proxy
+// configs) send credentials via Proxy-Authorization and expect a 407 on
+// failure, not the Authorization/401 pair origin servers use. h.auth only
+// knows how to read the latter, so Proxy-Authorization is copied onto a
+// cloned request as Authorization before delegating to it.
+func (h *forwardHandler) authenticateProxy(r *http.Request) (ok bool, realm string) {
+	v := r.Header.Get("Proxy-Authorization")
+	if v == "" {
+		return h.auth.Authenticate(r)
+	}
+	probe := r.Clone(r.Context())
+	probe.Header.Set("Authorization", v)
+	probe.Header.Del("Proxy-Authorization")
+	return h.auth.Authenticate(probe)
+}
+
+func (h *forwardHandler) handleForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not supported in forward mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "Forward proxy requires an absolute-URI request target", http.StatusBadRequest)
+		return
+	}
+
+	client, err := h.client()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch origin: %v", err), http.StatusBadGateway)
+		return
+	}
+	serveCached(w, h.store, h.cfg, client, r.URL.String(), r)
+}
+
+// client returns the *http.Client live fetches should use, chaining
+// through the configured upstream proxy when set — the same client is
+// handed to serveCached so the conditional GETs and background
+// stale-while-revalidate refreshes it performs for /proxy also honor the
+// chain in forward mode.
+func (h *forwardHandler) client() (*http.Client, error) {
+	if h.upstreamProxy == "" {
+		return http.DefaultClient, nil
+	}
+	proxyURL, err := url.Parse(h.upstreamProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream proxy: %w", err)
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}, nil
+}
+
+// handleConnect tunnels a CONNECT request to r.Host, dialing through the
+// configured upstream proxy when set.
+func (h *forwardHandler) handleConnect(w http.ResponseWriter, r *http.Request) {
+	dest, err := h.dialDestination(r.Host)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to connect: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer dest.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	clientConn, _, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to hijack connection: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	splice(clientConn, dest)
+}
+
+// dialDestination connects to host (a CONNECT request's "host:port"
+// target), chaining through the upstream proxy when configured by issuing
+// its own CONNECT request through that tunnel first, borrowing the
+// technique Kubernetes' SpdyRoundTripper uses to chain through a proxy.
+func (h *forwardHandler) dialDestination(host string) (net.Conn, error) {
+	if h.upstreamProxy == "" {
+		return net.DialTimeout("tcp", host, 10*time.Second)
+	}
+
+	proxyURL, err := url.Parse(h.upstreamProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream proxy: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", proxyURL.Host, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	connectReq, err := http.NewRequest(http.MethodConnect, "http://"+host, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := connectReq.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("upstream proxy CONNECT failed: %s", resp.Status)
+	}
+	return conn, nil
+}
+
+// splice copies bytes in both directions between a and b until either
+// side closes or errors.
+func splice(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
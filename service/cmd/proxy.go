@@ -0,0 +1,404 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-fuego/fuego"
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/auth"
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/cache"
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/metrics"
+)
+
+// allowedVaryHeaders lists the request headers this proxy is willing to
+// fold into a cache key. An origin naming "*" or any header outside this
+// set in its Vary response opts its responses out of caching entirely:
+// an unbounded per-value key (e.g. on Cookie) would otherwise let the
+// cache grow without bound, and "*" means every request is logically a
+// distinct representation anyway.
+var allowedVaryHeaders = map[string]bool{
+	"accept":          true,
+	"accept-encoding": true,
+	"accept-language": true,
+	"authorization":   true,
+	"origin":          true,
+}
+
+// varyNames parses an origin's Vary response header into the sorted,
+// lower-cased field names it names. ok is false when Vary contains "*"
+// or a header outside allowedVaryHeaders, meaning the response must not
+// be cached under a Vary-folded key at all.
+func varyNames(vary string) (names []string, ok bool) {
+	if vary == "" {
+		return nil, true
+	}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(vary, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if name == "" {
+			continue
+		}
+		if name == "*" || !allowedVaryHeaders[name] {
+			return nil, false
+		}
+		seen[name] = true
+	}
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+// cacheKey derives the cache key for targetURL as URL + hash(sorted
+// values of the named Vary headers).
+func cacheKey(targetURL string, names []string, h http.Header) string {
+	vals := make([]string, 0, len(names))
+	for _, name := range names {
+		vals = append(vals, strings.ToLower(strings.TrimSpace(h.Get(name))))
+	}
+	sort.Strings(vals)
+	sum := sha256.Sum256([]byte(strings.Join(vals, "\x00")))
+	return targetURL + "#" + hex.EncodeToString(sum[:8])
+}
+
+// varyIndexKey is the cache key of the per-URL index entry that records
+// which request headers targetURL's responses currently vary on, so a
+// lookup knows which header values to fold into the real key before it
+// has fetched anything for that URL.
+func varyIndexKey(targetURL string) string {
+	return targetURL + "#vary-index"
+}
+
+// resolveCacheKey folds the request's values for exactly the header
+// names targetURL's most recently stored response varies on (per its
+// Vary index entry, if any) into the cache key, so a Vary-negotiated
+// representation is never served to the wrong caller.
+func resolveCacheKey(c cache.Store, targetURL string, h http.Header) string {
+	idx, ok := c.Get(varyIndexKey(targetURL))
+	if !ok {
+		return cacheKey(targetURL, nil, h)
+	}
+	names, ok := varyNames(idx.Headers.Get("Vary"))
+	if !ok {
+		return cacheKey(targetURL, nil, h)
+	}
+	return cacheKey(targetURL, names, h)
+}
+
+func newServer(c cache.Store, a auth.Authenticator, cfg Config, opts ...func(*fuego.Server)) *fuego.Server {
+	s := fuego.NewServer(opts...)
+	fuego.Use(s, authMiddleware(a))
+
+	fuego.Get(s, "/proxy", func(ctx fuego.ContextNoBody) (any, error) {
+		w := ctx.Response()
+		r := ctx.Request()
+
+		targetURL := r.URL.Query().Get("url")
+		if targetURL == "" {
+			http.Error(w, "Missing url parameter", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		serveCached(w, c, cfg, http.DefaultClient, targetURL, r)
+		return nil, nil
+	})
+
+	fuego.Get(s, "/metrics", func(ctx fuego.ContextNoBody) (any, error) {
+		metrics.Handler().ServeHTTP(ctx.Response(), ctx.Request())
+		return nil, nil
+	})
+
+	fuego.Delete(s, "/cache", func(ctx fuego.ContextNoBody) (any, error) {
+		w := ctx.Response()
+		r := ctx.Request()
+
+		if cfg.DisableDelete {
+			http.Error(w, "Cache deletion is disabled", http.StatusForbidden)
+			return nil, nil
+		}
+
+		targetURL := r.URL.Query().Get("url")
+		if targetURL == "" {
+			http.Error(w, "Missing url parameter", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if c.Delete(resolveCacheKey(c, targetURL, r.Header)) {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+		return nil, nil
+	})
+
+	return s
+}
+
+// serveCached implements the shared HTTP caching decision /proxy and
+// forward mode both need: serve a fresh HIT, serve a stale-but-
+// revalidatable entry while refreshing it in the background, conditionally
+// revalidate an entry with a validator (including on Cache-Control:
+// no-cache, which must revalidate rather than be treated as a miss or
+// served fresh), honor only-if-cached, and otherwise fetch targetURL live.
+// client is injected so callers that chain through an upstream proxy (e.g.
+// forward mode) get that behavior for every fetch serveCached performs,
+// live or conditional or backgrounded.
+func serveCached(w http.ResponseWriter, c cache.Store, cfg Config, client *http.Client, targetURL string, r *http.Request) {
+	key := resolveCacheKey(c, targetURL, r.Header)
+	reqCC := cache.ParseCacheControl(r.Header.Get("Cache-Control"))
+
+	if entry, ok := c.Get(key); ok {
+		switch {
+		case reqCC.NoCache:
+			// no-cache means "must revalidate", not "treat as a
+			// miss" — reuse the entry's validators for a
+			// conditional GET instead of discarding them.
+			if entry.HasValidator() {
+				serveConditional(w, c, cfg, client, key, targetURL, r.Header, entry)
+				return
+			}
+
+		case entry.Fresh():
+			metrics.IncHits()
+			writeEntry(w, entry, "HIT")
+			return
+
+		case entry.StaleButRevalidatable():
+			metrics.IncHits()
+			writeEntry(w, entry, "STALE")
+			go revalidate(c, cfg, client, key, targetURL, entry)
+			return
+
+		case entry.HasValidator() && !reqCC.OnlyIfCached:
+			serveConditional(w, c, cfg, client, key, targetURL, r.Header, entry)
+			return
+		}
+
+		if reqCC.OnlyIfCached {
+			http.Error(w, "Not cached", http.StatusGatewayTimeout)
+			return
+		}
+	} else if reqCC.OnlyIfCached {
+		http.Error(w, "Not cached", http.StatusGatewayTimeout)
+		return
+	}
+
+	resp, err := fetchOrigin(client, targetURL, "", "")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch origin: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	metrics.IncMisses()
+	serveFreshResponse(w, c, cfg, targetURL, r.Header, resp)
+}
+
+// fetchOrigin issues a GET to targetURL via client, attaching
+// conditional-GET validators when provided.
+func fetchOrigin(client *http.Client, targetURL, ifNoneMatch, ifModifiedSince string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	if ifModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", ifModifiedSince)
+	}
+	return client.Do(req)
+}
+
+// serveConditional issues a conditional GET against targetURL using
+// entry's validators, serving a REVALIDATED hit on a 304 or falling
+// through to a normal MISS otherwise. Shared by the expired-with-validator
+// path and by Cache-Control: no-cache, which must always revalidate
+// rather than serve a HIT or treat the entry as a miss.
+func serveConditional(w http.ResponseWriter, c cache.Store, cfg Config, client *http.Client, key, targetURL string, reqHeader http.Header, entry *cache.Entry) {
+	resp, err := fetchOrigin(client, targetURL, entry.ETag, entry.LastModified)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch origin: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		metrics.IncHits()
+		refreshed := refreshEntry(entry, resp.Header, cfg)
+		c.Set(key, refreshed)
+		writeEntry(w, refreshed, "REVALIDATED")
+		return
+	}
+	metrics.IncMisses()
+	serveFreshResponse(w, c, cfg, targetURL, reqHeader, resp)
+}
+
+// serveFreshResponse reads a non-304 origin response, stores it in the
+// cache under the key implied by its own Vary header if cacheable
+// (refreshing the per-URL Vary index to match), and writes it to the
+// client as a MISS.
+func serveFreshResponse(w http.ResponseWriter, c cache.Store, cfg Config, targetURL string, reqHeader http.Header, resp *http.Response) {
+	body, err := readBody(resp, cfg)
+	if err != nil {
+		http.Error(w, "Failed to read origin response", http.StatusBadGateway)
+		return
+	}
+
+	if names, ok := varyNames(resp.Header.Get("Vary")); ok {
+		key := cacheKey(targetURL, names, reqHeader)
+		if entry, store := buildEntry(resp, body, key, cfg); store {
+			c.Set(key, entry)
+			c.Set(varyIndexKey(targetURL), &cache.Entry{
+				Headers:              http.Header{"Vary": {resp.Header.Get("Vary")}},
+				Expiry:               entry.Expiry,
+				StaleWhileRevalidate: entry.StaleWhileRevalidate,
+			})
+		}
+	}
+
+	for k, vals := range resp.Header {
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set("X-Proxy-Cache", "MISS")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// readBody reads resp's body, capped at cfg.MaxBodyBytes when set. When the
+// body is truncated to the cap, resp.Header is fixed up in place — dropping
+// Transfer-Encoding and rewriting Content-Length to the bytes actually
+// read — so whatever copies resp.Header afterward (the client response,
+// the cached Entry.Headers) describes the body that was really sent rather
+// than the origin's original, now-inaccurate framing.
+func readBody(resp *http.Response, cfg Config) ([]byte, error) {
+	if cfg.MaxBodyBytes <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cfg.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > cfg.MaxBodyBytes {
+		body = body[:cfg.MaxBodyBytes]
+		resp.Header.Del("Transfer-Encoding")
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	return body, nil
+}
+
+// buildEntry turns an origin response into a cache.Entry, applying
+// cfg.DefaultTTL when the origin sent no Cache-Control header at all.
+func buildEntry(resp *http.Response, body []byte, key string, cfg Config) (*cache.Entry, bool) {
+	cc := cache.ParseCacheControl(resp.Header.Get("Cache-Control"))
+	ttl := cc.TTL()
+	store := cc.ShouldStore()
+	if !store && !cc.NoStore && resp.Header.Get("Cache-Control") == "" && cfg.DefaultTTL > 0 {
+		ttl = int(cfg.DefaultTTL / time.Second)
+		store = true
+	}
+	if !store {
+		return nil, false
+	}
+	return &cache.Entry{
+		Body:                 body,
+		Headers:              resp.Header.Clone(),
+		Expiry:               time.Now().Add(time.Duration(ttl) * time.Second),
+		StoredAt:             time.Now(),
+		ETag:                 resp.Header.Get("ETag"),
+		LastModified:         resp.Header.Get("Last-Modified"),
+		VaryKey:              key,
+		StaleWhileRevalidate: time.Duration(cc.StaleWhileRevalidate) * time.Second,
+		MustRevalidate:       cc.MustRevalidate,
+	}, true
+}
+
+// refreshEntry applies a 304 response's headers to an existing entry,
+// keeping the stored body but refreshing its expiry and validators.
+func refreshEntry(old *cache.Entry, headers http.Header, cfg Config) *cache.Entry {
+	cc := cache.ParseCacheControl(headers.Get("Cache-Control"))
+	ttl := cc.TTL()
+	if ttl == 0 && cfg.DefaultTTL > 0 {
+		ttl = int(cfg.DefaultTTL / time.Second)
+	}
+	if ttl == 0 {
+		// Origins commonly omit Cache-Control on a 304 (only resending
+		// validators). Falling back to 0 here would make the entry
+		// stale again immediately, forcing a conditional GET on every
+		// request; reuse the entry's own previous freshness lifetime
+		// instead of cfg.DefaultTTL's zero value.
+		if lifetime := old.Expiry.Sub(old.StoredAt); lifetime > 0 {
+			ttl = int(lifetime / time.Second)
+		}
+	}
+	etag := headers.Get("ETag")
+	if etag == "" {
+		etag = old.ETag
+	}
+	lastModified := headers.Get("Last-Modified")
+	if lastModified == "" {
+		lastModified = old.LastModified
+	}
+	return &cache.Entry{
+		Body:                 old.Body,
+		Headers:              old.Headers,
+		Expiry:               time.Now().Add(time.Duration(ttl) * time.Second),
+		StoredAt:             time.Now(),
+		ETag:                 etag,
+		LastModified:         lastModified,
+		VaryKey:              old.VaryKey,
+		StaleWhileRevalidate: time.Duration(cc.StaleWhileRevalidate) * time.Second,
+		MustRevalidate:       cc.MustRevalidate,
+	}
+}
+
+// revalidate refetches targetURL via client in the background after a
+// stale-while-revalidate hit, updating or evicting the cached entry.
+func revalidate(c cache.Store, cfg Config, client *http.Client, key, targetURL string, old *cache.Entry) {
+	resp, err := fetchOrigin(client, targetURL, old.ETag, old.LastModified)
+	if err != nil {
+		log.Printf("background revalidation of %s failed: %v", targetURL, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		c.Set(key, refreshEntry(old, resp.Header, cfg))
+		return
+	}
+
+	body, err := readBody(resp, cfg)
+	if err != nil {
+		log.Printf("background revalidation of %s failed: %v", targetURL, err)
+		return
+	}
+	if entry, store := buildEntry(resp, body, key, cfg); store {
+		c.Set(key, entry)
+	} else {
+		c.Delete(key)
+	}
+}
+
+// writeEntry writes a cached entry to the client, annotating it with the
+// cache-status and freshness-age headers.
+func writeEntry(w http.ResponseWriter, entry *cache.Entry, status string) {
+	for k, vals := range entry.Headers {
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set("X-Proxy-Cache", status)
+	w.Header().Set("Age", strconv.Itoa(entry.Age()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(entry.Body)
+}
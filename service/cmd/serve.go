@@ -1,31 +1,38 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/coreos/go-systemd/daemon"
 	"github.com/go-fuego/fuego"
-	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/cache"
+	"github.com/marstimo/CS361-Group-4-Proxy-Cache/service/auth"
 	"github.com/spf13/cobra"
 )
 
 var (
-	port   int
-	apiKey string
+	port          int
+	authSpec      string
+	configPath    string
+	mode          string
+	upstreamProxy string
 )
 
-func authMiddleware(key string) func(http.Handler) http.Handler {
+func authMiddleware(a auth.Authenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			k := r.Header.Get("X-API-Key")
-			if k == "" {
-				k = r.URL.Query().Get("api_key")
-			}
-			if k != key {
+			ok, realm := a.Authenticate(r)
+			if !ok {
+				if realm != "" {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+				}
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
@@ -34,101 +41,112 @@ func authMiddleware(key string) func(http.Handler) http.Handler {
 	}
 }
 
-func newServer(c *cache.Cache, key string, opts ...func(*fuego.Server)) *fuego.Server {
-	s := fuego.NewServer(opts...)
-	fuego.Use(s, authMiddleware(key))
-
-	fuego.Get(s, "/proxy", func(ctx fuego.ContextNoBody) (any, error) {
-		w := ctx.Response()
-		r := ctx.Request()
-
-		targetURL := r.URL.Query().Get("url")
-		if targetURL == "" {
-			http.Error(w, "Missing url parameter", http.StatusBadRequest)
-			return nil, nil
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start the proxy cache server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			return err
 		}
-
-		if entry, ok := c.Get(targetURL); ok {
-			for k, vals := range entry.Headers {
-				for _, v := range vals {
-					w.Header().Add(k, v)
-				}
-			}
-			remaining := time.Until(entry.Expiry).Seconds()
-			w.Header().Set("X-Proxy-Cache", "HIT")
-			w.Header().Set("X-Cache-TTL-Remaining", strconv.Itoa(int(remaining)))
-			w.WriteHeader(http.StatusOK)
-			w.Write(entry.Body)
-			return nil, nil
+		if cmd.Flags().Changed("port") {
+			cfg.Listen = fmt.Sprintf(":%d", port)
 		}
-
-		resp, err := http.Get(targetURL)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch origin: %v", err), http.StatusBadGateway)
-			return nil, nil
+		if cmd.Flags().Changed("auth") {
+			cfg.Auth = authSpec
 		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			http.Error(w, "Failed to read origin response", http.StatusBadGateway)
-			return nil, nil
+		if cmd.Flags().Changed("mode") {
+			cfg.Mode = mode
 		}
-
-		cc := resp.Header.Get("Cache-Control")
-		maxAge, shouldStore := cache.ParseCacheControl(cc)
-		if shouldStore {
-			c.Set(targetURL, &cache.Entry{
-				Body:    body,
-				Headers: resp.Header.Clone(),
-				Expiry:  time.Now().Add(time.Duration(maxAge) * time.Second),
-			})
+		if cmd.Flags().Changed("upstream-proxy") {
+			cfg.UpstreamProxy = upstreamProxy
 		}
+		return runServe(cfg)
+	},
+}
 
-		for k, vals := range resp.Header {
-			for _, v := range vals {
-				w.Header().Add(k, v)
-			}
-		}
-		w.Header().Set("X-Proxy-Cache", "MISS")
-		w.WriteHeader(http.StatusOK)
-		w.Write(body)
-		return nil, nil
-	})
-
-	fuego.Delete(s, "/cache", func(ctx fuego.ContextNoBody) (any, error) {
-		w := ctx.Response()
-		r := ctx.Request()
-
-		targetURL := r.URL.Query().Get("url")
-		if targetURL == "" {
-			http.Error(w, "Missing url parameter", http.StatusBadRequest)
-			return nil, nil
+// runServe starts the server described by cfg and blocks until it exits,
+// either because it failed to serve or because SIGINT/SIGTERM asked for a
+// graceful shutdown.
+func runServe(cfg Config) error {
+	if cfg.Debug {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	}
+
+	a, err := auth.NewAuth(cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("invalid auth spec: %w", err)
+	}
+
+	store, err := newStore(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid backend config: %w", err)
+	}
+
+	if cfg.PIDFile != "" {
+		if err := os.WriteFile(cfg.PIDFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+			return fmt.Errorf("writing pid file: %w", err)
 		}
+		defer os.Remove(cfg.PIDFile)
+	}
 
-		if c.Delete(targetURL) {
-			w.WriteHeader(http.StatusNoContent)
-		} else {
-			http.Error(w, "Not found", http.StatusNotFound)
+	var run func() error
+	var shutdown func(context.Context) error
+
+	if cfg.Mode == "forward" {
+		h := &forwardHandler{
+			store:         store,
+			auth:          a,
+			cfg:           cfg,
+			upstreamProxy: resolveUpstreamProxy(cfg.UpstreamProxy),
 		}
-		return nil, nil
-	})
+		httpServer := &http.Server{Addr: cfg.Listen, Handler: h}
+		run = httpServer.ListenAndServe
+		shutdown = httpServer.Shutdown
+	} else {
+		s := newServer(store, a, cfg, fuego.WithAddr(cfg.Listen))
+		run = s.Run
+		shutdown = s.Server.Shutdown
+	}
 
-	return s
-}
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Proxy cache listening on %s (mode=%s)", cfg.Listen, cfg.Mode)
+		errCh <- run()
+	}()
 
-var serveCmd = &cobra.Command{
-	Use:   "serve",
-	Short: "Start the proxy cache server",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		s := newServer(cache.New(), apiKey, fuego.WithAddr(fmt.Sprintf(":%d", port)))
-		log.Printf("Proxy cache listening on :%d", port)
-		return s.Run()
-	},
+	if sent, err := daemon.SdNotify(false, daemon.SdNotifyReady); err != nil {
+		log.Printf("sd_notify failed: %v", err)
+	} else if sent {
+		log.Printf("sd_notify(READY=1) delivered")
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errCh:
+		return err
+	case sig := <-sigCh:
+		log.Printf("received %s, shutting down", sig)
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return shutdown(ctx)
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
-	serveCmd.Flags().IntVarP(&port, "port", "p", 8080, "port to listen on")
-	serveCmd.Flags().StringVarP(&apiKey, "api-key", "k", "default-api-key", "API key for authentication")
+	serveCmd.Flags().IntVarP(&port, "port", "p", 8080, "port to listen on (overrides config file)")
+	serveCmd.Flags().StringVar(&authSpec, "auth", "static://default-api-key",
+		"authentication spec: static://KEY, file:///path/to/keys, basic://user:pass, or basic:///path/to/.htpasswd (overrides config file)")
+	serveCmd.Flags().StringVarP(&configPath, "config", "c", "", "path to YAML config file")
+	serveCmd.Flags().StringVar(&mode, "mode", "proxy",
+		"server mode: proxy (/proxy?url=) or forward (transparent HTTP forward proxy with CONNECT support) (overrides config file)")
+	serveCmd.Flags().StringVar(&upstreamProxy, "upstream-proxy", "",
+		"chain forward-mode requests through this proxy (falls back to HTTPS_PROXY/HTTP_PROXY) (overrides config file)")
 }
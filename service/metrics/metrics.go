@@ -0,0 +1,42 @@
+// Package metrics holds process-wide cache counters exposed at /metrics in
+// a Prometheus-compatible text format, so operators can size the cache.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+var (
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	bytesUsed int64
+)
+
+// IncHits records a cache hit (fresh, stale-while-revalidate, or
+// revalidated).
+func IncHits() { atomic.AddUint64(&hits, 1) }
+
+// IncMisses records a cache miss that required an origin fetch.
+func IncMisses() { atomic.AddUint64(&misses, 1) }
+
+// IncEvictions records a backend evicting an entry to stay within its
+// configured bounds.
+func IncEvictions() { atomic.AddUint64(&evictions, 1) }
+
+// SetBytes records the backend's current total body size in bytes.
+func SetBytes(n int64) { atomic.StoreInt64(&bytesUsed, n) }
+
+// Handler serves the counters above in the Prometheus text exposition
+// format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintf(w, "# TYPE cache_hits_total counter\ncache_hits_total %d\n", atomic.LoadUint64(&hits))
+		fmt.Fprintf(w, "# TYPE cache_misses_total counter\ncache_misses_total %d\n", atomic.LoadUint64(&misses))
+		fmt.Fprintf(w, "# TYPE cache_evictions_total counter\ncache_evictions_total %d\n", atomic.LoadUint64(&evictions))
+		fmt.Fprintf(w, "# TYPE cache_bytes gauge\ncache_bytes %d\n", atomic.LoadInt64(&bytesUsed))
+	})
+}